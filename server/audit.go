@@ -0,0 +1,256 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit event type constants. Keep these in sync with every call site that
+// logs an auth event so operators can grep/filter on a stable vocabulary.
+const (
+	AuditRegistered              = "registered"
+	AuditLoginSuccess            = "login_success"
+	AuditLoginFailure            = "login_failure"
+	Audit2FASuccess              = "2fa_success"
+	Audit2FAFailure              = "2fa_failure"
+	AuditLogout                  = "logout"
+	AuditProtectedAccessDenied   = "protected_access_denied"
+	AuditRememberMeIssued        = "remember_me_issued"
+	AuditRememberMeRotated       = "remember_me_rotated"
+	AuditRememberMeTheftDetected = "remember_me_theft_detected"
+	AuditWebAuthnRegisterSuccess = "webauthn_register_success"
+	AuditWebAuthnRegisterFailure = "webauthn_register_failure"
+	AuditWebAuthnLoginSuccess    = "webauthn_login_success"
+	AuditWebAuthnLoginFailure    = "webauthn_login_failure"
+	AuditWebAuthnCloneDetected   = "webauthn_clone_detected"
+)
+
+// AuditEvent is one row in the auth audit trail.
+type AuditEvent struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Type      string            `json:"type"`
+	Email     string            `json:"email,omitempty"`
+	RemoteIP  string            `json:"remote_ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Outcome   string            `json:"outcome"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// AuditLogger records auth events. Handlers call Log once per event;
+// implementations decide where that event ends up (stdout, syslog, an
+// append-only file, an in-memory ring buffer for /audit, or several of
+// those at once via MultiAuditLogger).
+type AuditLogger interface {
+	Log(event AuditEvent)
+}
+
+// MultiAuditLogger fans a single event out to every logger in the slice.
+type MultiAuditLogger []AuditLogger
+
+func (m MultiAuditLogger) Log(event AuditEvent) {
+	for _, logger := range m {
+		logger.Log(event)
+	}
+}
+
+// JSONLinesAuditLogger writes one JSON object per line to w. It is the
+// default logger: easy to ship to any log aggregator that tails stdout.
+type JSONLinesAuditLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLinesAuditLogger writes audit events to w (os.Stdout if nil).
+func NewJSONLinesAuditLogger(w io.Writer) *JSONLinesAuditLogger {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &JSONLinesAuditLogger{w: w}
+}
+
+func (l *JSONLinesAuditLogger) Log(event AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	l.w.Write(append(encoded, '\n'))
+}
+
+// FileAuditLogger appends JSON lines to a file and fsyncs after every
+// write, so an audit trail survives a crash between writes.
+type FileAuditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditLogger opens (or creates) path for append-only writes.
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditLogger{file: file}, nil
+}
+
+func (l *FileAuditLogger) Log(event AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if _, err := l.file.Write(append(encoded, '\n')); err != nil {
+		return
+	}
+	l.file.Sync()
+}
+
+// RecentEventsAuditLogger keeps the last `capacity` events in memory so
+// the /audit endpoint has something to query without reading back a file
+// or syslog. It is meant to be combined with a durable logger via
+// MultiAuditLogger, not used on its own.
+type RecentEventsAuditLogger struct {
+	mu       sync.Mutex
+	capacity int
+	events   []AuditEvent
+}
+
+// NewRecentEventsAuditLogger retains up to capacity events.
+func NewRecentEventsAuditLogger(capacity int) *RecentEventsAuditLogger {
+	return &RecentEventsAuditLogger{capacity: capacity}
+}
+
+func (l *RecentEventsAuditLogger) Log(event AuditEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, event)
+	if len(l.events) > l.capacity {
+		l.events = l.events[len(l.events)-l.capacity:]
+	}
+}
+
+// Recent returns up to limit of the most recently logged events, newest
+// last.
+func (l *RecentEventsAuditLogger) Recent(limit int) []AuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limit <= 0 || limit > len(l.events) {
+		limit = len(l.events)
+	}
+	out := make([]AuditEvent, limit)
+	copy(out, l.events[len(l.events)-limit:])
+	return out
+}
+
+// clientIP returns the caller's IP, honoring X-Forwarded-For when the
+// immediate peer (r.RemoteAddr) is in trustedProxies. Without a trusted
+// proxy list, X-Forwarded-For is attacker-controlled and must be ignored.
+func clientIP(r *http.Request, trustedProxies []string) string {
+	remoteHost := stripPort(r.RemoteAddr)
+
+	if len(trustedProxies) == 0 || !contains(trustedProxies, remoteHost) {
+		return remoteHost
+	}
+
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" {
+		return remoteHost
+	}
+
+	parts := strings.Split(forwarded, ",")
+	return strings.TrimSpace(parts[0])
+}
+
+func stripPort(addr string) string {
+	if idx := strings.LastIndex(addr, ":"); idx != -1 {
+		return addr[:idx]
+	}
+	return addr
+}
+
+// isAdminEmail reports whether email is listed in ADMIN_EMAILS
+// (comma-separated). This is the only way to provision RoleAdmin: there is
+// no promotion endpoint, since granting audit access is an operator
+// decision made at deploy time, not a runtime API call.
+func isAdminEmail(email string) bool {
+	return contains(splitEnvList("ADMIN_EMAILS"), email)
+}
+
+func contains(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
+
+// audit logs event with the request's client IP and user agent filled in.
+func (s *Server) audit(r *http.Request, eventType, email, outcome string, details map[string]string) {
+	if s.auditLog == nil {
+		return
+	}
+	s.auditLog.Log(AuditEvent{
+		Timestamp: time.Now(),
+		Type:      eventType,
+		Email:     email,
+		RemoteIP:  clientIP(r, s.trustedProxies),
+		UserAgent: r.UserAgent(),
+		Outcome:   outcome,
+		Details:   details,
+	})
+}
+
+// auditHandler handles GET requests for recent audit events. It is gated behind
+// a valid session+CSRF pair belonging to an admin account. The caller's
+// identity comes from the authenticated session, never from a request
+// parameter, since the latter would let any logged-in user read the audit
+// trail by naming an admin's email.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, err := s.Authorize(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.store.GetByEmail(email)
+	if err != nil || user.Role != RoleAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	recent, ok := s.auditLog.(*RecentEventsAuditLogger)
+	if !ok {
+		if multi, isMulti := s.auditLog.(MultiAuditLogger); isMulti {
+			for _, logger := range multi {
+				if found, ok := logger.(*RecentEventsAuditLogger); ok {
+					recent = found
+					break
+				}
+			}
+		}
+	}
+	if recent == nil {
+		http.Error(w, "Audit query is not available on this server", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recent.Recent(200))
+}
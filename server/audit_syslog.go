@@ -0,0 +1,37 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogAuditLogger ships audit events to the local syslog daemon. It is
+// unavailable on windows and plan9, which have no log/syslog support.
+type SyslogAuditLogger struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogAuditLogger dials the local syslog daemon with the given
+// facility/tag (e.g. syslog.LOG_AUTH, "automatic-fiesta").
+func NewSyslogAuditLogger(priority syslog.Priority, tag string) (*SyslogAuditLogger, error) {
+	writer, err := syslog.New(priority, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditLogger{writer: writer}, nil
+}
+
+func (l *SyslogAuditLogger) Log(event AuditEvent) {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	if event.Outcome == "success" {
+		l.writer.Info(string(encoded))
+	} else {
+		l.writer.Warning(string(encoded))
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Authorize validates the session_token and csrf_token cookies on r against
+// a double-submit CSRF check (the csrf_token cookie must match the
+// X-CSRF-Token header) and an active session in s.store, returning the
+// authenticated email on success. Every handler that requires a logged-in
+// user should derive its identity from Authorize's return value, not from a
+// client-supplied form field, since the latter can be set to anyone's email.
+func (s *Server) Authorize(r *http.Request) (email string, err error) {
+	sessionToken, err := s.readCookie(r, "session_token")
+	if err != nil || sessionToken == "" {
+		return "", fmt.Errorf("missing or invalid session cookie")
+	}
+
+	// The client echoes the csrf_token cookie exactly as it reads it, i.e.
+	// the encoded value, so the double-submit check compares raw values.
+	rawCSRF, err := r.Cookie("csrf_token")
+	if err != nil || rawCSRF.Value == "" {
+		return "", fmt.Errorf("missing or invalid csrf cookie")
+	}
+	if r.Header.Get("X-CSRF-Token") != rawCSRF.Value {
+		return "", fmt.Errorf("csrf token mismatch")
+	}
+
+	csrfCookie, err := s.readCookie(r, "csrf_token")
+	if err != nil || csrfCookie == "" {
+		return "", fmt.Errorf("missing or invalid csrf cookie")
+	}
+
+	email, user, err := s.store.FindBySession(sessionToken)
+	if err != nil {
+		return "", fmt.Errorf("invalid session")
+	}
+	if user.CSRFToken != csrfCookie {
+		return "", fmt.Errorf("csrf token mismatch")
+	}
+
+	return email, nil
+}
+
+// PreAuthorize guards the /2fa step: it rejects a request that already
+// carries a valid full session, since re-running the second factor while
+// already authenticated is a sign of session confusion rather than a normal
+// login. A request with no session at all is the expected case and passes.
+func (s *Server) PreAuthorize(r *http.Request) error {
+	sessionToken, err := s.readCookie(r, "session_token")
+	if err != nil || sessionToken == "" {
+		return nil
+	}
+
+	if _, _, err := s.store.FindBySession(sessionToken); err == nil {
+		return fmt.Errorf("a session is already active")
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+const (
+	minHashKeyLen  = 32
+	minBlockKeyLen = 16
+)
+
+// KeyPair is a hash/block key pair used to authenticate (and optionally
+// encrypt) cookie values.
+type KeyPair struct {
+	HashKey  []byte
+	BlockKey []byte
+}
+
+// CookieCodec authenticates every cookie value this server sets, and
+// encrypts it when a block key is configured, so a cookie captured off the
+// wire or out of browser storage cannot be forged without the server's keys
+// (nor read, when encrypted). It supports key rotation:
+// pairs[0] is used to encode new cookies, and every pair is tried in order
+// when decoding, so cookies signed under a retired key still validate
+// until they expire.
+type CookieCodec struct {
+	codecs []*securecookie.SecureCookie
+}
+
+// NewCookieCodec builds a CookieCodec from pairs, newest first. It refuses
+// to start if no pairs are given or any hash key is shorter than 32 bytes,
+// since a short hash key defeats the point of signing cookies at all.
+func NewCookieCodec(pairs ...KeyPair) (*CookieCodec, error) {
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("cookie codec: at least one key pair is required")
+	}
+
+	codecs := make([]*securecookie.SecureCookie, 0, len(pairs))
+	for i, p := range pairs {
+		if len(p.HashKey) < minHashKeyLen {
+			return nil, fmt.Errorf("cookie codec: key pair %d hash key must be at least %d bytes", i, minHashKeyLen)
+		}
+		if len(p.BlockKey) != 0 && len(p.BlockKey) < minBlockKeyLen {
+			return nil, fmt.Errorf("cookie codec: key pair %d block key must be at least %d bytes", i, minBlockKeyLen)
+		}
+		codecs = append(codecs, securecookie.New(p.HashKey, p.BlockKey))
+	}
+
+	return &CookieCodec{codecs: codecs}, nil
+}
+
+// MustLoadCookieCodecFromEnv reads COOKIE_HASH_KEYS and COOKIE_BLOCK_KEYS
+// (comma-separated, hex-encoded, newest key first) and builds a
+// CookieCodec. It calls log.Fatal if the keys are missing or malformed,
+// since an auth server with no cookie keys should not boot.
+func MustLoadCookieCodecFromEnv() *CookieCodec {
+	hashKeys := splitEnvList("COOKIE_HASH_KEYS")
+	blockKeys := splitEnvList("COOKIE_BLOCK_KEYS")
+
+	if len(hashKeys) == 0 {
+		log.Fatal("cookie codec: COOKIE_HASH_KEYS is not set")
+	}
+	if len(blockKeys) != 0 && len(blockKeys) != len(hashKeys) {
+		log.Fatal("cookie codec: COOKIE_BLOCK_KEYS must have the same number of entries as COOKIE_HASH_KEYS, or be empty")
+	}
+
+	pairs := make([]KeyPair, len(hashKeys))
+	for i, hexHashKey := range hashKeys {
+		hashKey, err := hex.DecodeString(hexHashKey)
+		if err != nil {
+			log.Fatalf("cookie codec: COOKIE_HASH_KEYS[%d] is not valid hex: %v", i, err)
+		}
+		pairs[i] = KeyPair{HashKey: hashKey}
+
+		if len(blockKeys) != 0 {
+			blockKey, err := hex.DecodeString(blockKeys[i])
+			if err != nil {
+				log.Fatalf("cookie codec: COOKIE_BLOCK_KEYS[%d] is not valid hex: %v", i, err)
+			}
+			pairs[i].BlockKey = blockKey
+		}
+	}
+
+	codec, err := NewCookieCodec(pairs...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return codec
+}
+
+func splitEnvList(name string) []string {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	for i, p := range parts {
+		parts[i] = strings.TrimSpace(p)
+	}
+	return parts
+}
+
+// Encode authenticates (and encrypts, if a block key was given) value
+// under cookie name, using the newest key pair.
+func (c *CookieCodec) Encode(name string, value interface{}) (string, error) {
+	return c.codecs[0].Encode(name, value)
+}
+
+// Decode verifies a cookie value previously produced by Encode, trying
+// each key pair in order (newest first) so cookies issued before a key
+// rotation still decode correctly.
+func (c *CookieCodec) Decode(name, value string, dst interface{}) error {
+	var lastErr error
+	for _, codec := range c.codecs {
+		if err := codec.Decode(name, value, dst); err == nil {
+			return nil
+		} else {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// setCookie authenticates value under name with s.cookies and sets it as a
+// cookie with the given expiry and HttpOnly flag. Every outgoing cookie
+// with a value goes through this helper or setRememberMeCookie, both of
+// which encode it with s.cookies, so none of them can be forged without the
+// server's keys; clearCookie sets only an empty, expired value.
+func (s *Server) setCookie(w http.ResponseWriter, name, value string, expires time.Time, httpOnly bool) error {
+	encoded, err := s.cookies.Encode(name, value)
+	if err != nil {
+		return fmt.Errorf("encoding %s cookie: %w", name, err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encoded,
+		Expires:  expires,
+		HttpOnly: httpOnly,
+	})
+	return nil
+}
+
+// clearCookie expires name immediately, with no value to decode.
+func (s *Server) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:    name,
+		Value:   "",
+		Expires: time.Now(),
+	})
+}
+
+// setRememberMeCookie authenticates cookieValue and sets it as the
+// remember_me cookie. Unlike setCookie it marks the cookie Secure and
+// SameSite=Lax, since remember-me cookies are long-lived and should never
+// be sent over plaintext HTTP or leaked to cross-site requests.
+func (s *Server) setRememberMeCookie(w http.ResponseWriter, cookieValue string) error {
+	encoded, err := s.cookies.Encode("remember_me", cookieValue)
+	if err != nil {
+		return fmt.Errorf("encoding remember_me cookie: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "remember_me",
+		Value:    encoded,
+		Expires:  time.Now().Add(rememberMeTTL),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// readCookie reads name from r and decodes it with s.cookies.
+func (s *Server) readCookie(r *http.Request, name string) (string, error) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+
+	var value string
+	if err := s.cookies.Decode(name, c.Value, &value); err != nil {
+		return "", fmt.Errorf("decoding %s cookie: %w", name, err)
+	}
+	return value, nil
+}
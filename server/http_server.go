@@ -6,28 +6,62 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 type Login struct {
-	HashedPassword    string
-	SessionToken      string
-	CSRFToken         string
-	Pending_2fa_Token string
-	TOTPSecret        string
+	HashedPassword      string
+	SessionToken        string
+	CSRFToken           string
+	Pending_2fa_Token   string
+	TOTPSecret          string
+	WebAuthnCredentials []webauthn.Credential
+	LastOTPCounter      int64
+	RecoveryCodeHashes  []string
+	Role                string
 }
 
-var users = map[string]Login{}
+// Roles recognized by admin-gated endpoints such as /audit.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
+// Http_Server builds the default in-memory-backed Server and starts
+// listening on :8080. Callers that want a SQL- or Redis-backed store
+// should construct a Server directly with NewServer and call ListenAndServe.
 func Http_Server() {
-	http.HandleFunc("/register", register)
-	http.HandleFunc("/login", login)
-	http.HandleFunc("/2fa", twoFactor)
-	http.HandleFunc("/logout", logout)
-	http.HandleFunc("/protected", protected)
-	http.ListenAndServe(":8080", nil)
+	auditLog := MultiAuditLogger{
+		NewJSONLinesAuditLogger(nil),
+		NewRecentEventsAuditLogger(1000),
+	}
+	s := NewServer(NewMemoryStore(), MustLoadCookieCodecFromEnv(), loadWebAuthnFromEnv(), auditLog)
+	s.ListenAndServe(":8080")
 }
 
-func register(w http.ResponseWriter, r *http.Request) {
+// ListenAndServe registers every handler on a fresh ServeMux and serves it
+// on addr. The remember-me sweeper runs for the lifetime of the process.
+func (s *Server) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", s.register)
+	mux.HandleFunc("/login", s.login)
+	mux.HandleFunc("/2fa", s.twoFactor)
+	mux.HandleFunc("/2fa/webauthn/register/begin", s.webAuthnRegisterBegin)
+	mux.HandleFunc("/2fa/webauthn/register/finish", s.webAuthnRegisterFinish)
+	mux.HandleFunc("/2fa/webauthn/login/begin", s.webAuthnLoginBegin)
+	mux.HandleFunc("/2fa/webauthn/login/finish", s.webAuthnLoginFinish)
+	mux.HandleFunc("/remember", s.remember)
+	mux.HandleFunc("/logout", s.logout)
+	mux.HandleFunc("/protected", s.protected)
+	mux.HandleFunc("/audit", s.auditHandler)
+
+	s.startRememberTokenSweeper(1 * time.Hour)
+
+	return http.ListenAndServe(addr, mux)
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
 
 	// step 1: create a user account and save the hashed password. Generate and save TOTP secret key.
 
@@ -44,7 +78,7 @@ func register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, ok := users[email]; ok {
+	if _, err := s.store.GetByEmail(email); err == nil {
 		http.Error(w, "email already exists", http.StatusBadRequest)
 		return
 	}
@@ -56,18 +90,42 @@ func register(w http.ResponseWriter, r *http.Request) {
 		log.Fatal("Error generating secret key:", err)
 	}
 
-	users[email] = Login{HashedPassword: hashedPassword, TOTPSecret: secret}
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Could not generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	role := RoleUser
+	if isAdminEmail(email) {
+		role = RoleAdmin
+	}
+
+	user := Login{
+		HashedPassword:     hashedPassword,
+		TOTPSecret:         secret,
+		RecoveryCodeHashes: recoveryCodeHashes,
+		Role:               role,
+	}
+	if err := s.store.PutUser(email, user); err != nil {
+		http.Error(w, "Could not create user", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, AuditRegistered, email, "success", nil)
 
 	response := map[string]interface{}{
-		"message":     "Registration successful. Please setup TOTP Authentication.",
-		"qr_code_url": qrURL,
+		"message":            "Registration successful. Please setup TOTP Authentication.",
+		"qr_code_url":        qrURL,
+		"webauthn_available": s.webAuthn != nil,
+		"recovery_codes":     recoveryCodes,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-func login(w http.ResponseWriter, r *http.Request) {
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
 
 	// step 2: Verify email / password. Generate a temp token on success.
 
@@ -79,22 +137,33 @@ func login(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 
-	user, ok := users[email]
-	if !ok || !checkPasswordHash(password, user.HashedPassword) {
+	limitKey := rateLimitKey(email, r.RemoteAddr)
+	if !enforceRateLimit(w, limitKey) {
+		return
+	}
+
+	user, err := s.store.GetByEmail(email)
+	if err != nil || !checkPasswordHash(password, user.HashedPassword) {
+		recordFailedAttempt(limitKey)
+		s.audit(r, AuditLoginFailure, email, "invalid credentials", nil)
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	recordSuccessfulAttempt(limitKey)
+	s.audit(r, AuditLoginSuccess, email, "success", nil)
 
 	Pending_2fa_Token := generateToken(32)
 
-	users[email] = Login{HashedPassword: user.HashedPassword, Pending_2fa_Token: Pending_2fa_Token, TOTPSecret: user.TOTPSecret}
+	user.Pending_2fa_Token = Pending_2fa_Token
+	if err := s.store.PutUser(email, user); err != nil {
+		http.Error(w, "Could not start 2FA", http.StatusInternalServerError)
+		return
+	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "pending_2fa_token",
-		Value:    Pending_2fa_Token,
-		Expires:  time.Now().Add(5 * time.Minute), // 5min time limit
-		HttpOnly: true,                            // true so the cookie is not accessible by the client
-	})
+	if err := s.setCookie(w, "pending_2fa_token", Pending_2fa_Token, time.Now().Add(5*time.Minute), true); err != nil {
+		http.Error(w, "Could not start 2FA", http.StatusInternalServerError)
+		return
+	}
 
 	response := map[string]interface{}{
 		"message": "Email and password validated. You have 5 minutes to complete TOTP Authentication.",
@@ -104,7 +173,7 @@ func login(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func twoFactor(w http.ResponseWriter, r *http.Request) {
+func (s *Server) twoFactor(w http.ResponseWriter, r *http.Request) {
 
 	// step 3: Verify temp token, then verify TOTP code. On success generate and set session and crsf tokens. Clear temp token.
 
@@ -113,82 +182,97 @@ func twoFactor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	t, err := r.Cookie("pending_2fa_token")
-	if err != nil || t.Value == "" {
+	pendingToken, err := s.readCookie(r, "pending_2fa_token")
+	if err != nil || pendingToken == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	pendingToken := t.Value
-
-	errA := PreAuthorize(r)
+	errA := s.PreAuthorize(r)
 	if errA != nil {
 		fmt.Println(errA)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var user *Login
-	for _, u := range users {
-		if u.Pending_2fa_Token == pendingToken {
-			user = &u
-			break
-		}
-	}
-
-	if user == nil {
+	email, user, err := s.store.FindByPendingToken(pendingToken)
+	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	user_otp := r.FormValue("otp")
+	limitKey := rateLimitKey(email, r.RemoteAddr)
+	if !enforceRateLimit(w, limitKey) {
+		return
+	}
 
-	secondAuthPassed := verifyTOTP(user.TOTPSecret, user_otp)
+	// The second factor may be a TOTP code, a recovery code, or (via
+	// /2fa/webauthn/login/begin|finish, which calls completeTwoFactor
+	// directly) a WebAuthn assertion. A bare POST to /2fa is TOTP unless a
+	// recovery_code is supplied instead of otp.
+	var secondAuthPassed bool
+	message := "TOTP Authentication Successful."
+
+	if recoveryCode := r.FormValue("recovery_code"); recoveryCode != "" {
+		secondAuthPassed = consumeRecoveryCode(&user, recoveryCode)
+		message = "Recovery Code Authentication Successful."
+	} else {
+		secondAuthPassed = consumeTOTP(&user, r.FormValue("otp"))
+	}
 
 	if !secondAuthPassed {
+		recordFailedAttempt(limitKey)
+		s.audit(r, Audit2FAFailure, email, "invalid code", nil)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	recordSuccessfulAttempt(limitKey)
+	s.audit(r, Audit2FASuccess, email, "success", nil)
+
+	if err := s.completeTwoFactor(w, email, user); err != nil {
+		http.Error(w, "Could not complete 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": message,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
+// completeTwoFactor mints a fresh session+CSRF pair for email, persists
+// them, and clears the pending 2FA cookie. It is the shared tail of every
+// second-factor path: TOTP (twoFactor) and WebAuthn (webAuthnLoginFinish).
+func (s *Server) completeTwoFactor(w http.ResponseWriter, email string, user Login) error {
 	sessionToken := generateToken(32)
 	csrfToken := generateToken(32)
 
 	// Set session token as cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true, // true so the cookie is not accessible by the client
-	})
-
-	// Set CSRF token as cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "csrf_token",
-		Value:    csrfToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: false, // false so the client can save and send it back for verification
-	})
+	if err := s.setCookie(w, "session_token", sessionToken, time.Now().Add(24*time.Hour), true); err != nil {
+		return err
+	}
+
+	// Set CSRF token as cookie. HttpOnly is false so the client can read it
+	// and send it back for verification.
+	if err := s.setCookie(w, "csrf_token", csrfToken, time.Now().Add(24*time.Hour), false); err != nil {
+		return err
+	}
 
 	// Store tokens in user object
 	user.SessionToken = sessionToken
 	user.CSRFToken = csrfToken
 	user.Pending_2fa_Token = ""
-
-	http.SetCookie(w, &http.Cookie{
-		Name:    "pending_2fa_token",
-		Value:   "",
-		Expires: time.Now(),
-	})
-
-	response := map[string]interface{}{
-		"message": "TOTP Authentication Successful.",
+	if err := s.store.PutUser(email, user); err != nil {
+		return err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	s.clearCookie(w, "pending_2fa_token")
+	return nil
 }
 
-func protected(w http.ResponseWriter, r *http.Request) {
+func (s *Server) protected(w http.ResponseWriter, r *http.Request) {
 
 	// step 3: when a request is sent to the server the Authorize function verfies both tokens.
 
@@ -197,11 +281,16 @@ func protected(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := Authorize(r)
+	_, err := s.Authorize(r)
 	if err != nil {
-		fmt.Println(err)
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		if email, rmErr := s.resumeFromRememberMe(w, r); rmErr == nil {
+			fmt.Printf("resumed session for %s via remember-me token\n", email)
+		} else {
+			fmt.Println(err)
+			s.audit(r, AuditProtectedAccessDenied, r.FormValue("email"), "unauthorized", nil)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 	}
 
 	response := map[string]interface{}{
@@ -212,7 +301,7 @@ func protected(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func logout(w http.ResponseWriter, r *http.Request) {
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
 
 	// step 4: on logout the session token and csrf token are revoked
 
@@ -221,34 +310,24 @@ func logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := Authorize(r)
+	email, err := s.Authorize(r)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	email := r.FormValue("email")
-	user, ok := users[email]
-	if !ok {
+	if err := s.store.DeleteSession(email); err != nil {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
-	user.SessionToken = ""
-	user.CSRFToken = ""
-	users[email] = user
+	s.revokeRememberTokens(email)
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Expires: time.Now(),
-	})
+	s.clearCookie(w, "session_token")
+	s.clearCookie(w, "csrf_token")
+	s.clearCookie(w, "remember_me")
 
-	http.SetCookie(w, &http.Cookie{
-		Name:    "csrf_token",
-		Value:   "",
-		Expires: time.Now(),
-	})
+	s.audit(r, AuditLogout, email, "success", nil)
 
 	response := map[string]interface{}{
 		"message": "Logged Out",
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process UserStore backed by a map, guarded by a
+// RWMutex. It is the default backend for local development and tests, and
+// is lost on process restart. pendingIndex and sessionIndex mirror the
+// pending-2FA and session tokens so FindByPendingToken/FindBySession are
+// O(1) lookups instead of a scan over every account.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	users        map[string]Login
+	pendingIndex map[string]string // pending 2FA token -> email
+	sessionIndex map[string]string // session token -> email
+
+	rememberMu     sync.RWMutex
+	rememberTokens map[string]rememberRecord // lookup key -> record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:          map[string]Login{},
+		pendingIndex:   map[string]string{},
+		sessionIndex:   map[string]string{},
+		rememberTokens: map[string]rememberRecord{},
+	}
+}
+
+func (m *MemoryStore) GetByEmail(email string) (Login, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return Login{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// PutUser inserts or overwrites the Login for email, keeping pendingIndex
+// and sessionIndex in sync: any index entry that pointed at email's
+// previous pending/session token is dropped, and a new entry is added if
+// the incoming login has a non-empty token.
+func (m *MemoryStore) PutUser(email string, login Login) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if previous, ok := m.users[email]; ok {
+		if previous.Pending_2fa_Token != "" {
+			delete(m.pendingIndex, previous.Pending_2fa_Token)
+		}
+		if previous.SessionToken != "" {
+			delete(m.sessionIndex, previous.SessionToken)
+		}
+	}
+
+	if login.Pending_2fa_Token != "" {
+		m.pendingIndex[login.Pending_2fa_Token] = email
+	}
+	if login.SessionToken != "" {
+		m.sessionIndex[login.SessionToken] = email
+	}
+
+	m.users[email] = login
+	return nil
+}
+
+func (m *MemoryStore) FindByPendingToken(token string) (string, Login, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	email, ok := m.pendingIndex[token]
+	if !ok {
+		return "", Login{}, ErrUserNotFound
+	}
+	user, ok := m.users[email]
+	if !ok {
+		return "", Login{}, ErrUserNotFound
+	}
+	return email, user, nil
+}
+
+func (m *MemoryStore) FindBySession(token string) (string, Login, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	email, ok := m.sessionIndex[token]
+	if !ok {
+		return "", Login{}, ErrUserNotFound
+	}
+	user, ok := m.users[email]
+	if !ok {
+		return "", Login{}, ErrUserNotFound
+	}
+	return email, user, nil
+}
+
+func (m *MemoryStore) DeleteSession(email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[email]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if user.SessionToken != "" {
+		delete(m.sessionIndex, user.SessionToken)
+	}
+	user.SessionToken = ""
+	user.CSRFToken = ""
+	m.users[email] = user
+	return nil
+}
+
+func (m *MemoryStore) PutRememberToken(lookupKey string, record rememberRecord) error {
+	m.rememberMu.Lock()
+	defer m.rememberMu.Unlock()
+
+	m.rememberTokens[lookupKey] = record
+	return nil
+}
+
+func (m *MemoryStore) GetRememberToken(lookupKey string) (rememberRecord, error) {
+	m.rememberMu.RLock()
+	defer m.rememberMu.RUnlock()
+
+	record, ok := m.rememberTokens[lookupKey]
+	if !ok {
+		return rememberRecord{}, ErrUserNotFound
+	}
+	return record, nil
+}
+
+func (m *MemoryStore) DeleteRememberToken(lookupKey string) error {
+	m.rememberMu.Lock()
+	defer m.rememberMu.Unlock()
+
+	delete(m.rememberTokens, lookupKey)
+	return nil
+}
+
+func (m *MemoryStore) DeleteRememberTokensForEmail(email string) error {
+	m.rememberMu.Lock()
+	defer m.rememberMu.Unlock()
+
+	for key, record := range m.rememberTokens {
+		if record.Email == email {
+			delete(m.rememberTokens, key)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) SweepExpiredRememberTokens() error {
+	now := time.Now()
+	m.rememberMu.Lock()
+	defer m.rememberMu.Unlock()
+
+	for key, record := range m.rememberTokens {
+		if now.After(record.ExpiresAt) {
+			delete(m.rememberTokens, key)
+		}
+	}
+	return nil
+}
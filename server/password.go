@@ -0,0 +1,17 @@
+package server
+
+import "golang.org/x/crypto/bcrypt"
+
+// hashedPassword bcrypt-hashes a plaintext password for storage.
+func hashedPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPasswordHash reports whether password matches hash.
+func checkPasswordHash(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
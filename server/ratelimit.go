@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitWindow      = 15 * time.Minute
+	rateLimitMaxAttempts = 5
+	rateLimitBaseBackoff = 30 * time.Second
+	rateLimitMaxBackoff  = 30 * time.Minute
+)
+
+// attemptRecord tracks failed auth attempts for a single email+IP key.
+type attemptRecord struct {
+	failures     int
+	windowStart  time.Time
+	blockedUntil time.Time
+}
+
+var (
+	rateLimiterMu sync.Mutex
+	rateLimiter   = map[string]*attemptRecord{}
+)
+
+// rateLimitKey identifies a client for rate limiting purposes: the email
+// being attempted and the caller's IP, so a brute force against one
+// account from one IP is throttled without penalizing every user behind a
+// shared NAT or proxy.
+func rateLimitKey(email, remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return email + "|" + host
+}
+
+// checkRateLimit reports whether key is currently blocked and, if so, how
+// long the caller should wait before retrying.
+func checkRateLimit(key string) (blocked bool, retryAfter time.Duration) {
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+
+	record, ok := rateLimiter[key]
+	if !ok {
+		return false, 0
+	}
+
+	now := time.Now()
+	if now.Before(record.blockedUntil) {
+		return true, record.blockedUntil.Sub(now)
+	}
+	return false, 0
+}
+
+// recordFailedAttempt registers a failed /login or /2fa attempt for key.
+// Once rateLimitMaxAttempts failures land within rateLimitWindow, every
+// further failure doubles the lockout, up to rateLimitMaxBackoff.
+func recordFailedAttempt(key string) {
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+
+	now := time.Now()
+	record, ok := rateLimiter[key]
+	if !ok || now.Sub(record.windowStart) > rateLimitWindow {
+		record = &attemptRecord{windowStart: now}
+		rateLimiter[key] = record
+	}
+
+	record.failures++
+
+	if record.failures > rateLimitMaxAttempts {
+		backoff := rateLimitBaseBackoff << uint(record.failures-rateLimitMaxAttempts-1)
+		if backoff > rateLimitMaxBackoff || backoff <= 0 {
+			backoff = rateLimitMaxBackoff
+		}
+		record.blockedUntil = now.Add(backoff)
+	}
+}
+
+// recordSuccessfulAttempt clears any failure history for key.
+func recordSuccessfulAttempt(key string) {
+	rateLimiterMu.Lock()
+	defer rateLimiterMu.Unlock()
+	delete(rateLimiter, key)
+}
+
+// enforceRateLimit checks key and, if blocked, writes a 429 with
+// Retry-After and returns false. Callers should stop handling the request
+// when it returns false.
+func enforceRateLimit(w http.ResponseWriter, key string) bool {
+	blocked, retryAfter := checkRateLimit(key)
+	if !blocked {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	http.Error(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+	return false
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(d.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,47 @@
+package server
+
+import "testing"
+
+func TestRecordFailedAttemptBacksOffAfterThreshold(t *testing.T) {
+	key := rateLimitKey("backoff@example.com", "203.0.113.1:1234")
+
+	for i := 0; i < rateLimitMaxAttempts; i++ {
+		recordFailedAttempt(key)
+	}
+	if blocked, _ := checkRateLimit(key); blocked {
+		t.Fatal("should not be blocked until more than rateLimitMaxAttempts failures")
+	}
+
+	recordFailedAttempt(key)
+	blocked, retryAfter := checkRateLimit(key)
+	if !blocked {
+		t.Fatal("should be blocked after exceeding rateLimitMaxAttempts failures")
+	}
+	if retryAfter <= 0 || retryAfter > rateLimitMaxBackoff {
+		t.Errorf("retryAfter = %v, want within (0, %v]", retryAfter, rateLimitMaxBackoff)
+	}
+}
+
+func TestRecordSuccessfulAttemptClearsHistory(t *testing.T) {
+	key := rateLimitKey("clears@example.com", "203.0.113.2:1234")
+
+	for i := 0; i < rateLimitMaxAttempts+1; i++ {
+		recordFailedAttempt(key)
+	}
+	if blocked, _ := checkRateLimit(key); !blocked {
+		t.Fatal("expected key to be blocked before a successful attempt")
+	}
+
+	recordSuccessfulAttempt(key)
+	if blocked, _ := checkRateLimit(key); blocked {
+		t.Error("a successful attempt should clear the failure history")
+	}
+}
+
+func TestRateLimitKeyStripsPort(t *testing.T) {
+	a := rateLimitKey("user@example.com", "203.0.113.3:4567")
+	b := rateLimitKey("user@example.com", "203.0.113.3:9999")
+	if a != b {
+		t.Errorf("rateLimitKey should be port-independent: %q != %q", a, b)
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a UserStore backed by Redis. Session and pending-2FA tokens
+// are indexed as their own keys so FindBySession/FindByPendingToken are O(1)
+// lookups, and Redis' native TTLs retire stale tokens without a background
+// sweeper. The CSRF token is kept only inside the user's JSON record.
+type RedisStore struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+const (
+	redisUserKeyPrefix          = "user:"
+	redisSessionKeyPrefix       = "session:"
+	redisPendingKeyPrefix       = "pending2fa:"
+	redisRememberKeyPrefix      = "remember:"
+	redisRememberEmailKeyPrefix = "remember_email:" // set of lookup keys per email
+)
+
+// NewRedisStore wraps an already-connected *redis.Client as a UserStore.
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client, ctx: context.Background()}
+}
+
+func (r *RedisStore) GetByEmail(email string) (Login, error) {
+	raw, err := r.client.Get(r.ctx, redisUserKeyPrefix+email).Result()
+	if err == redis.Nil {
+		return Login{}, ErrUserNotFound
+	}
+	if err != nil {
+		return Login{}, err
+	}
+
+	var u Login
+	if err := json.Unmarshal([]byte(raw), &u); err != nil {
+		return Login{}, err
+	}
+	return u, nil
+}
+
+// PutUser inserts or overwrites the Login for email. If the previous Login
+// had a different session or pending-2FA token, its index key is deleted
+// first, so a rotation (2FA completion, remember-me auto-resume) doesn't
+// leave the old key alive in Redis until its original TTL expires.
+func (r *RedisStore) PutUser(email string, login Login) error {
+	previous, err := r.GetByEmail(email)
+	hadPrevious := err == nil
+
+	raw, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	if hadPrevious && previous.SessionToken != "" && previous.SessionToken != login.SessionToken {
+		pipe.Del(r.ctx, redisSessionKeyPrefix+previous.SessionToken)
+	}
+	if hadPrevious && previous.Pending_2fa_Token != "" && previous.Pending_2fa_Token != login.Pending_2fa_Token {
+		pipe.Del(r.ctx, redisPendingKeyPrefix+previous.Pending_2fa_Token)
+	}
+
+	pipe.Set(r.ctx, redisUserKeyPrefix+email, raw, 0)
+	if login.SessionToken != "" {
+		pipe.Set(r.ctx, redisSessionKeyPrefix+login.SessionToken, email, 24*time.Hour)
+	}
+	if login.Pending_2fa_Token != "" {
+		pipe.Set(r.ctx, redisPendingKeyPrefix+login.Pending_2fa_Token, email, 5*time.Minute)
+	}
+	_, err = pipe.Exec(r.ctx)
+	return err
+}
+
+func (r *RedisStore) FindByPendingToken(token string) (string, Login, error) {
+	email, err := r.client.Get(r.ctx, redisPendingKeyPrefix+token).Result()
+	if err == redis.Nil {
+		return "", Login{}, ErrUserNotFound
+	}
+	if err != nil {
+		return "", Login{}, err
+	}
+
+	user, err := r.GetByEmail(email)
+	if err != nil {
+		return "", Login{}, err
+	}
+	return email, user, nil
+}
+
+func (r *RedisStore) FindBySession(token string) (string, Login, error) {
+	email, err := r.client.Get(r.ctx, redisSessionKeyPrefix+token).Result()
+	if err == redis.Nil {
+		return "", Login{}, ErrUserNotFound
+	}
+	if err != nil {
+		return "", Login{}, err
+	}
+
+	user, err := r.GetByEmail(email)
+	if err != nil {
+		return "", Login{}, err
+	}
+	return email, user, nil
+}
+
+func (r *RedisStore) DeleteSession(email string) error {
+	user, err := r.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	if user.SessionToken != "" {
+		pipe.Del(r.ctx, redisSessionKeyPrefix+user.SessionToken)
+	}
+	user.SessionToken = ""
+	user.CSRFToken = ""
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	pipe.Set(r.ctx, redisUserKeyPrefix+email, raw, 0)
+	_, err = pipe.Exec(r.ctx)
+	return err
+}
+
+// PutRememberToken stores record under lookupKey with a TTL derived from
+// record.ExpiresAt, and adds lookupKey to the per-email set that
+// DeleteRememberTokensForEmail uses to find every token belonging to a user.
+func (r *RedisStore) PutRememberToken(lookupKey string, record rememberRecord) error {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(record.ExpiresAt)
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+
+	emailSetKey := redisRememberEmailKeyPrefix + record.Email
+	pipe := r.client.TxPipeline()
+	pipe.Set(r.ctx, redisRememberKeyPrefix+lookupKey, raw, ttl)
+	pipe.SAdd(r.ctx, emailSetKey, lookupKey)
+	pipe.Expire(r.ctx, emailSetKey, rememberMeTTL)
+	_, err = pipe.Exec(r.ctx)
+	return err
+}
+
+func (r *RedisStore) GetRememberToken(lookupKey string) (rememberRecord, error) {
+	raw, err := r.client.Get(r.ctx, redisRememberKeyPrefix+lookupKey).Result()
+	if err == redis.Nil {
+		return rememberRecord{}, ErrUserNotFound
+	}
+	if err != nil {
+		return rememberRecord{}, err
+	}
+
+	var record rememberRecord
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return rememberRecord{}, err
+	}
+	return record, nil
+}
+
+func (r *RedisStore) DeleteRememberToken(lookupKey string) error {
+	record, err := r.GetRememberToken(lookupKey)
+	if err == ErrUserNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Del(r.ctx, redisRememberKeyPrefix+lookupKey)
+	pipe.SRem(r.ctx, redisRememberEmailKeyPrefix+record.Email, lookupKey)
+	_, err = pipe.Exec(r.ctx)
+	return err
+}
+
+func (r *RedisStore) DeleteRememberTokensForEmail(email string) error {
+	emailSetKey := redisRememberEmailKeyPrefix + email
+	lookupKeys, err := r.client.SMembers(r.ctx, emailSetKey).Result()
+	if err != nil {
+		return err
+	}
+	if len(lookupKeys) == 0 {
+		return nil
+	}
+
+	pipe := r.client.TxPipeline()
+	for _, lookupKey := range lookupKeys {
+		pipe.Del(r.ctx, redisRememberKeyPrefix+lookupKey)
+	}
+	pipe.Del(r.ctx, emailSetKey)
+	_, err = pipe.Exec(r.ctx)
+	return err
+}
+
+// SweepExpiredRememberTokens is a no-op: Redis' native TTL on each
+// remember: key already retires expired tokens.
+func (r *RedisStore) SweepExpiredRememberTokens() error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rememberRecord is the server-side state for a single remember-me token.
+// Only the lookup key and a hash of the validator are ever persisted; the
+// validator itself is sent to the client once and never stored. It is kept
+// in whichever UserStore the server was built with (RememberStore), not a
+// package-level map, so it survives a restart and is visible to every
+// instance behind a shared SQL/Redis backend.
+type rememberRecord struct {
+	Email         string
+	ValidatorHash string
+	ExpiresAt     time.Time
+}
+
+const rememberMeTTL = 30 * 24 * time.Hour
+
+// ErrRememberMeTheftDetected marks a validator mismatch against a known
+// lookup key, the signature of a stolen or replayed remember-me cookie.
+var ErrRememberMeTheftDetected = errors.New("remember-me token mismatch")
+
+// generateRememberToken creates a fresh lookupKey/validator pair, stores
+// sha256(validator) indexed by lookupKey, and returns the cookie value
+// ("lookupKey:validator") to hand back to the client.
+func (s *Server) generateRememberToken(email string) (string, error) {
+	lookupKey, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("generating lookup key: %w", err)
+	}
+	validator, err := randomToken(32)
+	if err != nil {
+		return "", fmt.Errorf("generating validator: %w", err)
+	}
+
+	record := rememberRecord{
+		Email:         email,
+		ValidatorHash: hashValidator(validator),
+		ExpiresAt:     time.Now().Add(rememberMeTTL),
+	}
+	if err := s.store.PutRememberToken(lookupKey, record); err != nil {
+		return "", fmt.Errorf("storing remember-me token: %w", err)
+	}
+
+	return lookupKey + ":" + validator, nil
+}
+
+// randomToken returns a hex-encoded random token of n bytes.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// consumeRememberToken validates a "lookupKey:validator" cookie value,
+// rotating the token on success. On a validator mismatch for a known
+// lookupKey, every remember-me token for that user is revoked, since a
+// mismatch on an otherwise-valid lookup key is the signature of a stolen
+// or replayed cookie.
+func (s *Server) consumeRememberToken(cookieValue string) (email string, rotated string, err error) {
+	parts := strings.SplitN(cookieValue, ":", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("malformed remember-me token")
+	}
+	lookupKey, validator := parts[0], parts[1]
+
+	record, err := s.store.GetRememberToken(lookupKey)
+	if err != nil {
+		return "", "", fmt.Errorf("unknown remember-me token")
+	}
+	if time.Now().After(record.ExpiresAt) {
+		s.store.DeleteRememberToken(lookupKey)
+		return "", "", fmt.Errorf("expired remember-me token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashValidator(validator)), []byte(record.ValidatorHash)) != 1 {
+		s.revokeRememberTokens(record.Email)
+		return record.Email, "", fmt.Errorf("%w: revoked all remember-me tokens for %s", ErrRememberMeTheftDetected, record.Email)
+	}
+
+	s.store.DeleteRememberToken(lookupKey)
+
+	rotated, err = s.generateRememberToken(record.Email)
+	if err != nil {
+		return "", "", err
+	}
+	return record.Email, rotated, nil
+}
+
+// revokeRememberTokens deletes every remember-me token belonging to email.
+func (s *Server) revokeRememberTokens(email string) {
+	s.store.DeleteRememberTokensForEmail(email)
+}
+
+// startRememberTokenSweeper runs SweepExpiredRememberTokens on a fixed
+// interval for the lifetime of the process.
+func (s *Server) startRememberTokenSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.store.SweepExpiredRememberTokens()
+		}
+	}()
+}
+
+// remember issues an opt-in long-lived remember-me cookie. It must be
+// called with a valid session (i.e. immediately after /2fa succeeds).
+func (s *Server) remember(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, err := s.Authorize(r)
+	if err != nil {
+		fmt.Println(err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	cookieValue, err := s.generateRememberToken(email)
+	if err != nil {
+		http.Error(w, "Could not create remember-me token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.setRememberMeCookie(w, cookieValue); err != nil {
+		http.Error(w, "Could not create remember-me token", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, AuditRememberMeIssued, email, "success", nil)
+
+	response := map[string]interface{}{
+		"message": "Remember-me enabled. You will stay logged in on this device.",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// resumeFromRememberMe attempts to establish a fresh session from a
+// remember-me cookie when a request arrives with no valid session. On
+// success it mints a new session+CSRF pair, rotates the remember-me
+// token, and returns the authenticated email.
+func (s *Server) resumeFromRememberMe(w http.ResponseWriter, r *http.Request) (string, error) {
+	cookieValue, err := s.readCookie(r, "remember_me")
+	if err != nil || cookieValue == "" {
+		return "", fmt.Errorf("no remember-me cookie present")
+	}
+
+	email, rotated, err := s.consumeRememberToken(cookieValue)
+	if err != nil {
+		s.clearCookie(w, "remember_me")
+		if errors.Is(err, ErrRememberMeTheftDetected) {
+			s.audit(r, AuditRememberMeTheftDetected, email, err.Error(), nil)
+		}
+		return "", err
+	}
+
+	user, err := s.store.GetByEmail(email)
+	if err != nil {
+		return "", fmt.Errorf("user %s no longer exists", email)
+	}
+
+	sessionToken := generateToken(32)
+	csrfToken := generateToken(32)
+
+	user.SessionToken = sessionToken
+	user.CSRFToken = csrfToken
+	if err := s.store.PutUser(email, user); err != nil {
+		return "", err
+	}
+
+	if err := s.setCookie(w, "session_token", sessionToken, time.Now().Add(24*time.Hour), true); err != nil {
+		return "", err
+	}
+	if err := s.setCookie(w, "csrf_token", csrfToken, time.Now().Add(24*time.Hour), false); err != nil {
+		return "", err
+	}
+	if err := s.setRememberMeCookie(w, rotated); err != nil {
+		return "", err
+	}
+
+	s.audit(r, AuditRememberMeRotated, email, "success", nil)
+
+	return email, nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestServer() *Server {
+	return NewServer(NewMemoryStore(), nil, nil, nil)
+}
+
+func TestConsumeRememberTokenRotates(t *testing.T) {
+	const email = "rotate@example.com"
+	s := newTestServer()
+
+	cookieValue, err := s.generateRememberToken(email)
+	if err != nil {
+		t.Fatalf("generateRememberToken: %v", err)
+	}
+
+	gotEmail, rotated, err := s.consumeRememberToken(cookieValue)
+	if err != nil {
+		t.Fatalf("consumeRememberToken: %v", err)
+	}
+	if gotEmail != email {
+		t.Errorf("email = %q, want %q", gotEmail, email)
+	}
+	if rotated == "" {
+		t.Fatal("rotated token is empty")
+	}
+	if rotated == cookieValue {
+		t.Error("rotated token must differ from the original")
+	}
+
+	if _, _, err := s.consumeRememberToken(cookieValue); err == nil {
+		t.Error("the original token should no longer be valid after rotation")
+	}
+
+	if _, _, err := s.consumeRememberToken(rotated); err != nil {
+		t.Errorf("the rotated token should be valid: %v", err)
+	}
+}
+
+func TestConsumeRememberTokenTheftDetection(t *testing.T) {
+	const email = "theft@example.com"
+	s := newTestServer()
+
+	cookieValue, err := s.generateRememberToken(email)
+	if err != nil {
+		t.Fatalf("generateRememberToken: %v", err)
+	}
+
+	// Replay the lookup key with a forged validator, the signature of a
+	// stolen or replayed cookie.
+	parts := splitLookupAndValidator(t, cookieValue)
+	forged := parts[0] + ":" + "not-the-real-validator"
+
+	gotEmail, rotated, err := s.consumeRememberToken(forged)
+	if !errors.Is(err, ErrRememberMeTheftDetected) {
+		t.Fatalf("err = %v, want ErrRememberMeTheftDetected", err)
+	}
+	if gotEmail != email {
+		t.Errorf("email = %q, want %q (theft detection must still report whose tokens were revoked)", gotEmail, email)
+	}
+	if rotated != "" {
+		t.Errorf("rotated = %q, want empty on theft detection", rotated)
+	}
+
+	// The legitimate lookup key must also be revoked as a result.
+	if _, _, err := s.consumeRememberToken(cookieValue); err == nil {
+		t.Error("the original token should be revoked after theft detection")
+	}
+}
+
+func splitLookupAndValidator(t *testing.T, cookieValue string) [2]string {
+	t.Helper()
+	for i := range cookieValue {
+		if cookieValue[i] == ':' {
+			return [2]string{cookieValue[:i], cookieValue[i+1:]}
+		}
+	}
+	t.Fatalf("malformed cookie value %q", cookieValue)
+	return [2]string{}
+}
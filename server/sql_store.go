@@ -0,0 +1,182 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// DialectPostgres and DialectSQLite select the placeholder syntax SQLStore
+// uses when building queries: Postgres requires $1, $2, ... while SQLite and
+// MySQL use positional "?" placeholders.
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+const selectColumns = `email, hashed_password, session_token, csrf_token, pending_2fa_token,
+		totp_secret, webauthn_credentials, last_otp_counter, recovery_code_hashes, role`
+
+// SQLStore is a UserStore backed by database/sql, suitable for SQLite or
+// Postgres. Callers are responsible for opening db with the driver of their
+// choice (e.g. "sqlite3" or "postgres") and for running the schema in
+// sql_store_schema.sql before first use. WebAuthnCredentials and
+// RecoveryCodeHashes are stored as JSON text, since the schema keeps them in
+// a single column rather than a child table.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewSQLStore wraps an already-open *sql.DB as a UserStore. dialect selects
+// the placeholder syntax to use (DialectPostgres or DialectSQLite); any
+// other value falls back to "?" placeholders.
+func NewSQLStore(db *sql.DB, dialect string) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+// ph returns the nth (1-indexed) placeholder for s.dialect.
+func (s *SQLStore) ph(n int) string {
+	if s.dialect == DialectPostgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// scanRow scans one users row (in selectColumns order, email first) into a
+// Login, decoding the JSON-encoded WebAuthnCredentials/RecoveryCodeHashes
+// columns.
+func scanRow(row *sql.Row) (string, Login, error) {
+	var email string
+	var u Login
+	var credentialsJSON, recoveryHashesJSON string
+
+	err := row.Scan(&email, &u.HashedPassword, &u.SessionToken, &u.CSRFToken, &u.Pending_2fa_Token,
+		&u.TOTPSecret, &credentialsJSON, &u.LastOTPCounter, &recoveryHashesJSON, &u.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", Login{}, ErrUserNotFound
+		}
+		return "", Login{}, err
+	}
+
+	if err := json.Unmarshal([]byte(credentialsJSON), &u.WebAuthnCredentials); err != nil {
+		return "", Login{}, fmt.Errorf("decoding webauthn_credentials: %w", err)
+	}
+	if err := json.Unmarshal([]byte(recoveryHashesJSON), &u.RecoveryCodeHashes); err != nil {
+		return "", Login{}, fmt.Errorf("decoding recovery_code_hashes: %w", err)
+	}
+
+	return email, u, nil
+}
+
+func (s *SQLStore) GetByEmail(email string) (Login, error) {
+	row := s.db.QueryRow(fmt.Sprintf(`SELECT %s FROM users WHERE email = %s`, selectColumns, s.ph(1)), email)
+	_, u, err := scanRow(row)
+	return u, err
+}
+
+func (s *SQLStore) PutUser(email string, login Login) error {
+	if login.WebAuthnCredentials == nil {
+		login.WebAuthnCredentials = []webauthn.Credential{}
+	}
+	if login.RecoveryCodeHashes == nil {
+		login.RecoveryCodeHashes = []string{}
+	}
+
+	credentialsJSON, err := json.Marshal(login.WebAuthnCredentials)
+	if err != nil {
+		return fmt.Errorf("encoding webauthn_credentials: %w", err)
+	}
+	recoveryHashesJSON, err := json.Marshal(login.RecoveryCodeHashes)
+	if err != nil {
+		return fmt.Errorf("encoding recovery_code_hashes: %w", err)
+	}
+
+	_, err = s.db.Exec(fmt.Sprintf(`
+		INSERT INTO users (email, hashed_password, session_token, csrf_token, pending_2fa_token,
+			totp_secret, webauthn_credentials, last_otp_counter, recovery_code_hashes, role)
+		VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+		ON CONFLICT(email) DO UPDATE SET
+			hashed_password = excluded.hashed_password,
+			session_token = excluded.session_token,
+			csrf_token = excluded.csrf_token,
+			pending_2fa_token = excluded.pending_2fa_token,
+			totp_secret = excluded.totp_secret,
+			webauthn_credentials = excluded.webauthn_credentials,
+			last_otp_counter = excluded.last_otp_counter,
+			recovery_code_hashes = excluded.recovery_code_hashes,
+			role = excluded.role`,
+		s.ph(1), s.ph(2), s.ph(3), s.ph(4), s.ph(5), s.ph(6), s.ph(7), s.ph(8), s.ph(9), s.ph(10)),
+		email, login.HashedPassword, login.SessionToken, login.CSRFToken, login.Pending_2fa_Token,
+		login.TOTPSecret, string(credentialsJSON), login.LastOTPCounter, string(recoveryHashesJSON), login.Role)
+	return err
+}
+
+func (s *SQLStore) FindByPendingToken(token string) (string, Login, error) {
+	row := s.db.QueryRow(fmt.Sprintf(`SELECT %s FROM users WHERE pending_2fa_token = %s`, selectColumns, s.ph(1)), token)
+	return scanRow(row)
+}
+
+func (s *SQLStore) FindBySession(token string) (string, Login, error) {
+	row := s.db.QueryRow(fmt.Sprintf(`SELECT %s FROM users WHERE session_token = %s`, selectColumns, s.ph(1)), token)
+	return scanRow(row)
+}
+
+func (s *SQLStore) DeleteSession(email string) error {
+	res, err := s.db.Exec(fmt.Sprintf(`UPDATE users SET session_token = '', csrf_token = '' WHERE email = %s`, s.ph(1)), email)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) PutRememberToken(lookupKey string, record rememberRecord) error {
+	_, err := s.db.Exec(fmt.Sprintf(`
+		INSERT INTO remember_tokens (lookup_key, email, validator_hash, expires_at)
+		VALUES (%s, %s, %s, %s)
+		ON CONFLICT(lookup_key) DO UPDATE SET
+			email = excluded.email,
+			validator_hash = excluded.validator_hash,
+			expires_at = excluded.expires_at`,
+		s.ph(1), s.ph(2), s.ph(3), s.ph(4)),
+		lookupKey, record.Email, record.ValidatorHash, record.ExpiresAt)
+	return err
+}
+
+func (s *SQLStore) GetRememberToken(lookupKey string) (rememberRecord, error) {
+	row := s.db.QueryRow(fmt.Sprintf(`
+		SELECT email, validator_hash, expires_at FROM remember_tokens WHERE lookup_key = %s`, s.ph(1)), lookupKey)
+
+	var record rememberRecord
+	if err := row.Scan(&record.Email, &record.ValidatorHash, &record.ExpiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rememberRecord{}, ErrUserNotFound
+		}
+		return rememberRecord{}, err
+	}
+	return record, nil
+}
+
+func (s *SQLStore) DeleteRememberToken(lookupKey string) error {
+	_, err := s.db.Exec(fmt.Sprintf(`DELETE FROM remember_tokens WHERE lookup_key = %s`, s.ph(1)), lookupKey)
+	return err
+}
+
+func (s *SQLStore) DeleteRememberTokensForEmail(email string) error {
+	_, err := s.db.Exec(fmt.Sprintf(`DELETE FROM remember_tokens WHERE email = %s`, s.ph(1)), email)
+	return err
+}
+
+func (s *SQLStore) SweepExpiredRememberTokens() error {
+	_, err := s.db.Exec(`DELETE FROM remember_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+	return err
+}
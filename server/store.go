@@ -0,0 +1,90 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ErrUserNotFound is returned by UserStore lookups that find no matching row.
+var ErrUserNotFound = errors.New("server: user not found")
+
+// UserStore abstracts the persistence layer for user accounts and their
+// associated session/CSRF/pending-2FA state. Handlers in this package talk
+// only to a UserStore, never to a concrete backend, so the backend can be
+// swapped between an in-memory map (tests, local dev), SQL (SQLite/Postgres),
+// or Redis (native TTLs for short-lived tokens) without touching handler code.
+type UserStore interface {
+	// GetByEmail returns the Login for email, or ErrUserNotFound.
+	GetByEmail(email string) (Login, error)
+
+	// PutUser inserts or overwrites the Login for email.
+	PutUser(email string, login Login) error
+
+	// FindByPendingToken looks up a user by their pending 2FA token in
+	// O(1) rather than scanning every account.
+	FindByPendingToken(token string) (email string, login Login, err error)
+
+	// FindBySession looks up a user by their active session token.
+	FindBySession(token string) (email string, login Login, err error)
+
+	// DeleteSession clears the session and CSRF tokens for email.
+	DeleteSession(email string) error
+
+	RememberStore
+}
+
+// RememberStore persists remember-me tokens. It is a sibling of UserStore
+// rather than folded into a single flat interface, since remember-me state
+// is keyed by lookup key rather than email, but every backend implements
+// both on the same underlying store so a deployment only configures one
+// dependency. Keeping it off a package-level map (the original
+// implementation) means remember-me tokens survive a restart and are
+// visible to every instance of a horizontally-scaled deployment, same as
+// session/pending-2FA state.
+type RememberStore interface {
+	// PutRememberToken stores record under lookupKey, replacing any
+	// existing record for that key.
+	PutRememberToken(lookupKey string, record rememberRecord) error
+
+	// GetRememberToken returns the record for lookupKey, or ErrUserNotFound.
+	GetRememberToken(lookupKey string) (rememberRecord, error)
+
+	// DeleteRememberToken removes a single lookupKey's record.
+	DeleteRememberToken(lookupKey string) error
+
+	// DeleteRememberTokensForEmail removes every remember-me record
+	// belonging to email, e.g. on logout or theft detection.
+	DeleteRememberTokensForEmail(email string) error
+
+	// SweepExpiredRememberTokens removes every record whose ExpiresAt has
+	// passed. Backends with native TTL support (Redis) may implement this
+	// as a no-op.
+	SweepExpiredRememberTokens() error
+}
+
+// Server holds the dependencies every handler needs. Construct one with
+// NewServer and register its handler methods with an *http.ServeMux.
+type Server struct {
+	store          UserStore
+	cookies        *CookieCodec
+	webAuthn       *webauthn.WebAuthn // nil disables the WebAuthn routes
+	auditLog       AuditLogger        // nil disables audit logging
+	trustedProxies []string           // peers allowed to set X-Forwarded-For
+}
+
+// NewServer wires a Server to the given UserStore and CookieCodec. Every
+// cookie this server sets or reads is authenticated (and optionally
+// encrypted) through cookies, so callers must supply one. webAuthn may be
+// nil, in which case the /2fa/webauthn/* routes respond 501 and TOTP
+// remains the only second factor. auditLog may be nil to disable auditing.
+func NewServer(store UserStore, cookies *CookieCodec, webAuthn *webauthn.WebAuthn, auditLog AuditLogger) *Server {
+	return &Server{store: store, cookies: cookies, webAuthn: webAuthn, auditLog: auditLog}
+}
+
+// WithTrustedProxies sets the peer addresses allowed to supply
+// X-Forwarded-For for audit logging, and returns s for chaining.
+func (s *Server) WithTrustedProxies(proxies []string) *Server {
+	s.trustedProxies = proxies
+	return s
+}
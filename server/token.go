@@ -0,0 +1,13 @@
+package server
+
+// generateToken returns a hex-encoded random token of n bytes, for use as a
+// session, CSRF, or pending-2FA token. Unlike randomToken it never returns
+// an error: crypto/rand failing is treated as fatal, since every caller
+// needs a token to proceed and has no sensible fallback.
+func generateToken(n int) string {
+	token, err := randomToken(n)
+	if err != nil {
+		panic("server: failed to generate random token: " + err.Error())
+	}
+	return token
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	totpSecretBytes = 20 // 160 bits, the RFC 4226 recommended HMAC-SHA1 key size
+	totpDigits      = 6
+	totpSkewSteps   = 1 // tolerate the previous/next time step for clock drift
+)
+
+// generateSecretKey creates a fresh TOTP secret for email and returns it
+// alongside an otpauth:// URI an authenticator app can scan as a QR code.
+func generateSecretKey(email string) (secret string, qrURL string, err error) {
+	raw := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("generating TOTP secret: %w", err)
+	}
+	secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	uri := url.URL{
+		Scheme: "otpauth",
+		Host:   "totp",
+		Path:   "/automatic-fiesta:" + email,
+	}
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", "automatic-fiesta")
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(totpStepSeconds))
+	uri.RawQuery = q.Encode()
+
+	return secret, uri.String(), nil
+}
+
+// verifyTOTP reports whether otp is a valid RFC 6238 TOTP code for secret
+// within +/- totpSkewSteps of the current time step, tolerating clock drift.
+// On success it returns the step that actually matched, which may be
+// earlier or later than currentTOTPCounter() - callers that need a
+// single-use guarantee must gate on that returned step, not on "now", or
+// the skew window reopens a replay it was meant to close. It does not track
+// replay itself; callers that need a single-use guarantee should go through
+// consumeTOTP instead.
+func verifyTOTP(secret, otp string) (matchedCounter int64, ok bool) {
+	if len(otp) != totpDigits {
+		return 0, false
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	now := currentTOTPCounter()
+	for skew := -totpSkewSteps; skew <= totpSkewSteps; skew++ {
+		counter := now + int64(skew)
+		if hotp(key, counter) == otp {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// hotp computes the RFC 4226 HOTP value for key at counter, truncated to
+// totpDigits decimal digits.
+func hotp(key []byte, counter int64) string {
+	var counterBytes [8]byte
+	binary.BigEndian.PutUint64(counterBytes[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counterBytes[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	truncated := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, truncated%mod)
+}
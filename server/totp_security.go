@@ -0,0 +1,95 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpStepSeconds   = 30
+	recoveryCodeCount = 10
+)
+
+// currentTOTPCounter is the TOTP time-step counter for "now", i.e. the
+// same counter verifyTOTP derives internally from the current time.
+func currentTOTPCounter() int64 {
+	return time.Now().Unix() / totpStepSeconds
+}
+
+// consumeTOTP verifies otp against the user's secret and rejects it if its
+// time-step counter has already been consumed, closing the replay window a
+// bare verifyTOTP call leaves open. It gates and stores the counter that
+// actually matched inside verifyTOTP's skew window, not currentTOTPCounter()
+// ("now"), since a code accepted for a neighboring step under clock drift
+// would otherwise be replayable once "now" catches up to it.
+func consumeTOTP(user *Login, otp string) bool {
+	counter, ok := verifyTOTP(user.TOTPSecret, otp)
+	if !ok {
+		return false
+	}
+
+	if counter <= user.LastOTPCounter {
+		return false
+	}
+
+	user.LastOTPCounter = counter
+	return true
+}
+
+// generateRecoveryCodes creates recoveryCodeCount single-use codes,
+// returning the plaintext codes (to show the user exactly once) and their
+// bcrypt hashes (the only form persisted).
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	codes = make([]string, recoveryCodeCount)
+	hashes = make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating recovery code: %w", err)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, fmt.Errorf("hashing recovery code: %w", err)
+		}
+
+		codes[i] = code
+		hashes[i] = string(hash)
+	}
+
+	return codes, hashes, nil
+}
+
+// randomRecoveryCode returns a code of the form "XXXXX-XXXXX" drawn from
+// an unambiguous alphabet (no 0/O/1/I).
+func randomRecoveryCode() (string, error) {
+	const alphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+	b := make([]byte, 10)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = alphabet[n.Int64()]
+	}
+
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+// consumeRecoveryCode checks code against the user's stored recovery code
+// hashes. On a match, that hash is removed so the code cannot be reused.
+func consumeRecoveryCode(user *Login, code string) bool {
+	for i, hash := range user.RecoveryCodeHashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(code)) == nil {
+			user.RecoveryCodeHashes = append(user.RecoveryCodeHashes[:i], user.RecoveryCodeHashes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
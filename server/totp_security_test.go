@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/base32"
+	"testing"
+)
+
+func TestConsumeTOTPRejectsReplay(t *testing.T) {
+	secret, _, err := generateSecretKey("replay@example.com")
+	if err != nil {
+		t.Fatalf("generateSecretKey: %v", err)
+	}
+
+	otp := hotp(mustDecodeSecret(t, secret), currentTOTPCounter())
+	user := &Login{TOTPSecret: secret}
+
+	if !consumeTOTP(user, otp) {
+		t.Fatal("first use of a valid code should be accepted")
+	}
+	if consumeTOTP(user, otp) {
+		t.Error("replaying the same code must be rejected")
+	}
+}
+
+// TestConsumeTOTPGatesOnMatchedCounterNotNow guards against regressing to
+// gating/storing currentTOTPCounter() ("now") instead of the step verifyTOTP
+// actually matched inside its skew window: under clock drift a code for
+// counter+1 can be accepted while "now" is still counter, and the replay
+// guard must remember counter+1, not counter, or the same code stays valid
+// once "now" catches up to it.
+func TestConsumeTOTPGatesOnMatchedCounterNotNow(t *testing.T) {
+	secret, _, err := generateSecretKey("drift@example.com")
+	if err != nil {
+		t.Fatalf("generateSecretKey: %v", err)
+	}
+
+	key := mustDecodeSecret(t, secret)
+	now := currentTOTPCounter()
+	futureOTP := hotp(key, now+1)
+	user := &Login{TOTPSecret: secret}
+
+	if !consumeTOTP(user, futureOTP) {
+		t.Fatal("a code for the next time step should be accepted within the skew window")
+	}
+	if user.LastOTPCounter != now+1 {
+		t.Errorf("LastOTPCounter = %d, want %d (the step that actually matched, not currentTOTPCounter())", user.LastOTPCounter, now+1)
+	}
+
+	// Replaying the same code right away must be rejected. The
+	// LastOTPCounter check above is what keeps it rejected once "now"
+	// reaches now+1; this test does not advance the clock.
+	if consumeTOTP(user, futureOTP) {
+		t.Error("replaying the same code must be rejected")
+	}
+}
+
+func TestConsumeTOTPRejectsInvalidCode(t *testing.T) {
+	secret, _, err := generateSecretKey("invalid@example.com")
+	if err != nil {
+		t.Fatalf("generateSecretKey: %v", err)
+	}
+
+	user := &Login{TOTPSecret: secret}
+	if consumeTOTP(user, "000000") {
+		t.Error("an arbitrary code should not verify")
+	}
+}
+
+func TestConsumeRecoveryCodeSingleUse(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes: %v", err)
+	}
+
+	user := &Login{RecoveryCodeHashes: hashes}
+	code := codes[0]
+
+	if !consumeRecoveryCode(user, code) {
+		t.Fatal("a freshly generated recovery code should be accepted")
+	}
+	if consumeRecoveryCode(user, code) {
+		t.Error("a recovery code must not be usable twice")
+	}
+	if len(user.RecoveryCodeHashes) != len(hashes)-1 {
+		t.Errorf("RecoveryCodeHashes has %d entries, want %d", len(user.RecoveryCodeHashes), len(hashes)-1)
+	}
+}
+
+func mustDecodeSecret(t *testing.T, secret string) []byte {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding TOTP secret: %v", err)
+	}
+	return key
+}
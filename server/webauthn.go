@@ -0,0 +1,300 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// webAuthnCeremonyTTL bounds how long a begin/finish round trip may take
+// before its challenge is discarded.
+const webAuthnCeremonyTTL = 5 * time.Minute
+
+var (
+	webAuthnCeremoniesMu sync.Mutex
+	webAuthnCeremonies   = map[string]webAuthnCeremony{}
+)
+
+type webAuthnCeremony struct {
+	session   webauthn.SessionData
+	expiresAt time.Time
+}
+
+// webAuthnUser adapts Login to the webauthn.User interface the library
+// needs to build and verify ceremonies.
+type webAuthnUser struct {
+	email string
+	login Login
+}
+
+func (u webAuthnUser) WebAuthnID() []byte                         { return []byte(u.email) }
+func (u webAuthnUser) WebAuthnName() string                       { return u.email }
+func (u webAuthnUser) WebAuthnDisplayName() string                { return u.email }
+func (u webAuthnUser) WebAuthnIcon() string                       { return "" }
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential { return u.login.WebAuthnCredentials }
+
+// loadWebAuthnFromEnv builds a *webauthn.WebAuthn from WEBAUTHN_RP_ID and
+// WEBAUTHN_RP_ORIGINS (comma-separated). It returns nil, disabling the
+// /2fa/webauthn/* routes, when WEBAUTHN_RP_ID is unset, so a deployment
+// that only wants TOTP does not need to configure a relying party.
+func loadWebAuthnFromEnv() *webauthn.WebAuthn {
+	rpID := strings.TrimSpace(os.Getenv("WEBAUTHN_RP_ID"))
+	if rpID == "" {
+		return nil
+	}
+
+	origins := splitEnvList("WEBAUTHN_RP_ORIGINS")
+	if len(origins) == 0 {
+		log.Fatal("webauthn: WEBAUTHN_RP_ID is set but WEBAUTHN_RP_ORIGINS is empty")
+	}
+
+	displayName := strings.TrimSpace(os.Getenv("WEBAUTHN_RP_DISPLAY_NAME"))
+	if displayName == "" {
+		displayName = rpID
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: displayName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		log.Fatalf("webauthn: could not configure relying party: %v", err)
+	}
+	return w
+}
+
+func (s *Server) requireWebAuthn(w http.ResponseWriter) bool {
+	if s.webAuthn == nil {
+		http.Error(w, "WebAuthn is not configured on this server", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+func storeCeremony(key string, session *webauthn.SessionData) {
+	webAuthnCeremoniesMu.Lock()
+	defer webAuthnCeremoniesMu.Unlock()
+	webAuthnCeremonies[key] = webAuthnCeremony{session: *session, expiresAt: time.Now().Add(webAuthnCeremonyTTL)}
+}
+
+func takeCeremony(key string) (webauthn.SessionData, error) {
+	webAuthnCeremoniesMu.Lock()
+	defer webAuthnCeremoniesMu.Unlock()
+
+	ceremony, ok := webAuthnCeremonies[key]
+	delete(webAuthnCeremonies, key)
+	if !ok {
+		return webauthn.SessionData{}, fmt.Errorf("no WebAuthn ceremony in progress")
+	}
+	if time.Now().After(ceremony.expiresAt) {
+		return webauthn.SessionData{}, fmt.Errorf("WebAuthn ceremony expired")
+	}
+	return ceremony.session, nil
+}
+
+// webAuthnRegisterBegin starts registration of a new authenticator for the
+// already-logged-in user identified by the session cookie.
+func (s *Server) webAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireWebAuthn(w) {
+		return
+	}
+	email, err := s.Authorize(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.store.GetByEmail(email)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(webAuthnUser{email: email, login: user})
+	if err != nil {
+		s.audit(r, AuditWebAuthnRegisterFailure, email, err.Error(), nil)
+		http.Error(w, "Could not begin WebAuthn registration", http.StatusInternalServerError)
+		return
+	}
+
+	sessionToken, err := r.Cookie("session_token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	storeCeremony(sessionToken.Value, session)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(creation)
+}
+
+// webAuthnRegisterFinish verifies the browser's attestation response and
+// appends the new credential to the user's account.
+func (s *Server) webAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireWebAuthn(w) {
+		return
+	}
+	email, err := s.Authorize(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.store.GetByEmail(email)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	sessionToken, err := r.Cookie("session_token")
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	session, err := takeCeremony(sessionToken.Value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	credential, err := s.webAuthn.FinishRegistration(webAuthnUser{email: email, login: user}, session, r)
+	if err != nil {
+		s.audit(r, AuditWebAuthnRegisterFailure, email, "could not verify credential", nil)
+		http.Error(w, "Could not verify new credential", http.StatusUnauthorized)
+		return
+	}
+
+	user.WebAuthnCredentials = append(user.WebAuthnCredentials, *credential)
+	if err := s.store.PutUser(email, user); err != nil {
+		http.Error(w, "Could not save new credential", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, AuditWebAuthnRegisterSuccess, email, "success", nil)
+
+	response := map[string]interface{}{
+		"message": "Security key registered.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// webAuthnLoginBegin starts a WebAuthn assertion ceremony as the second
+// factor for the pending login identified by pending_2fa_token.
+func (s *Server) webAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireWebAuthn(w) {
+		return
+	}
+
+	pendingToken, err := s.readCookie(r, "pending_2fa_token")
+	if err != nil || pendingToken == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	email, user, err := s.store.FindByPendingToken(pendingToken)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(webAuthnUser{email: email, login: user})
+	if err != nil {
+		s.audit(r, AuditWebAuthnLoginFailure, email, err.Error(), nil)
+		http.Error(w, "Could not begin WebAuthn login", http.StatusInternalServerError)
+		return
+	}
+
+	storeCeremony(pendingToken, session)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assertion)
+}
+
+// webAuthnLoginFinish verifies the browser's assertion response and, on
+// success, completes the second factor the same way TOTP verification
+// does. On a sign-count regression (the library's CloneWarning) the
+// assertion is rejected and a clone-detected audit event naming the
+// credential ID is logged; the stored credential is not updated.
+func (s *Server) webAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.requireWebAuthn(w) {
+		return
+	}
+
+	pendingToken, err := s.readCookie(r, "pending_2fa_token")
+	if err != nil || pendingToken == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	email, user, err := s.store.FindByPendingToken(pendingToken)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := takeCeremony(pendingToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	credential, err := s.webAuthn.FinishLogin(webAuthnUser{email: email, login: user}, session, r)
+	if err != nil {
+		s.audit(r, AuditWebAuthnLoginFailure, email, "could not verify assertion", nil)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if credential.Authenticator.CloneWarning {
+		s.audit(r, AuditWebAuthnCloneDetected, email, "sign count regression", map[string]string{
+			"credential_id": fmt.Sprintf("%x", credential.ID),
+		})
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	for i, stored := range user.WebAuthnCredentials {
+		if string(stored.ID) == string(credential.ID) {
+			user.WebAuthnCredentials[i] = *credential
+			break
+		}
+	}
+
+	if err := s.completeTwoFactor(w, email, user); err != nil {
+		http.Error(w, "Could not complete 2FA", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, AuditWebAuthnLoginSuccess, email, "success", nil)
+
+	response := map[string]interface{}{
+		"message": "WebAuthn Authentication Successful.",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}